@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AuthStrategy produces the credentials a UaaRegistrar presents to UAA and
+// describes how a registered OAuth client should be configured to
+// authenticate the same way. This lets operators register clients using
+// private_key_jwt or mTLS, rather than only a shared client_credentials
+// secret.
+type AuthStrategy interface {
+	// AuthHeader returns the value to set on the Authorization header of
+	// outgoing requests, or "" if authentication happens at the transport
+	// layer (e.g. mTLS).
+	AuthHeader() (string, error)
+
+	// Refresh obtains new auth material, invoked once at construction and
+	// again whenever UAA reports the current credentials have expired.
+	Refresh() error
+
+	// GrantType is the UAA authorized_grant_types value that clients
+	// registered under this strategy should be given.
+	GrantType() string
+
+	// Scopes lists the UAA scopes that should be granted to clients
+	// registered under this strategy.
+	Scopes() []string
+
+	// ConfigureTransport customizes the HTTP transport used to talk to
+	// UAA, e.g. to present a client certificate for mTLS. Implementations
+	// that don't need transport-level configuration may leave it a no-op.
+	ConfigureTransport(transport *http.Transport)
+}
+
+// ClientCredentialsStrategy is the original strategy: it exchanges a
+// client_credentials grant for an opaque bearer token via a TokenRefresher.
+type ClientCredentialsStrategy struct {
+	tokenRefresher TokenRefresher
+	scopes         []string
+	token          string
+}
+
+// NewClientCredentialsStrategy wraps a TokenRefresher as an AuthStrategy
+// describing a standard client_credentials-authenticated OAuth client.
+func NewClientCredentialsStrategy(tokenRefresher TokenRefresher, scopes []string) *ClientCredentialsStrategy {
+	return &ClientCredentialsStrategy{
+		tokenRefresher: tokenRefresher,
+		scopes:         scopes,
+	}
+}
+
+func (s *ClientCredentialsStrategy) AuthHeader() (string, error) {
+	return s.token, nil
+}
+
+func (s *ClientCredentialsStrategy) Refresh() error {
+	token, err := s.tokenRefresher.RefreshAuthToken()
+	if err != nil {
+		return err
+	}
+	s.token = token
+	return nil
+}
+
+func (s *ClientCredentialsStrategy) GrantType() string {
+	return "client_credentials"
+}
+
+func (s *ClientCredentialsStrategy) Scopes() []string {
+	return s.scopes
+}
+
+func (s *ClientCredentialsStrategy) ConfigureTransport(transport *http.Transport) {}
+
+// JWTBearerStrategy authenticates using a signed JWT assertion exchanged
+// for an access token via the urn:ietf:params:oauth:grant-type:jwt-bearer
+// grant, as used by UAA's private_key_jwt clients.
+type JWTBearerStrategy struct {
+	// TokenURL is the UAA token endpoint, e.g. https://uaa.example.com/oauth/token.
+	TokenURL string
+	// ClientID identifies the registered private_key_jwt client.
+	ClientID string
+	// Signer produces a signed JWT assertion asserting ClientID, to be
+	// exchanged for an access token.
+	Signer func(clientID string) (string, error)
+	// HTTPClient is used to call TokenURL; defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	scopes []string
+	token  string
+}
+
+// NewJWTBearerStrategy builds a JWTBearerStrategy. scopes are the scopes
+// requested clients registered under this strategy should receive.
+func NewJWTBearerStrategy(tokenURL, clientID string, signer func(clientID string) (string, error), scopes []string) *JWTBearerStrategy {
+	return &JWTBearerStrategy{
+		TokenURL: tokenURL,
+		ClientID: clientID,
+		Signer:   signer,
+		scopes:   scopes,
+	}
+}
+
+func (s *JWTBearerStrategy) AuthHeader() (string, error) {
+	return s.token, nil
+}
+
+func (s *JWTBearerStrategy) Refresh() error {
+	assertion, err := s.Signer(s.ClientID)
+	if err != nil {
+		return fmt.Errorf("signing jwt-bearer assertion: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	form.Set("client_id", s.ClientID)
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.PostForm(s.TokenURL, form)
+	if err != nil {
+		return fmt.Errorf("exchanging jwt-bearer assertion: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwt-bearer token exchange failed: %d", resp.StatusCode)
+	}
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return fmt.Errorf("decoding jwt-bearer token response: %w", err)
+	}
+
+	s.token = strings.TrimSpace(tokenResponse.TokenType + " " + tokenResponse.AccessToken)
+	return nil
+}
+
+func (s *JWTBearerStrategy) GrantType() string {
+	return "urn:ietf:params:oauth:grant-type:jwt-bearer"
+}
+
+func (s *JWTBearerStrategy) Scopes() []string {
+	return s.scopes
+}
+
+func (s *JWTBearerStrategy) ConfigureTransport(transport *http.Transport) {}
+
+// MTLSStrategy authenticates to UAA by presenting a client certificate at
+// the TLS layer, rather than a bearer token.
+type MTLSStrategy struct {
+	Certificate tls.Certificate
+	// RootCAs, if set, is used to verify UAA's server certificate.
+	RootCAs *x509.CertPool
+
+	scopes []string
+}
+
+// NewMTLSStrategy builds an MTLSStrategy presenting cert for every request.
+func NewMTLSStrategy(cert tls.Certificate, rootCAs *x509.CertPool, scopes []string) *MTLSStrategy {
+	return &MTLSStrategy{
+		Certificate: cert,
+		RootCAs:     rootCAs,
+		scopes:      scopes,
+	}
+}
+
+func (s *MTLSStrategy) AuthHeader() (string, error) {
+	return "", nil
+}
+
+func (s *MTLSStrategy) Refresh() error {
+	return nil
+}
+
+func (s *MTLSStrategy) GrantType() string {
+	return "client_credentials"
+}
+
+func (s *MTLSStrategy) Scopes() []string {
+	return s.scopes
+}
+
+func (s *MTLSStrategy) ConfigureTransport(transport *http.Transport) {
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{s.Certificate}
+	if s.RootCAs != nil {
+		transport.TLSClientConfig.RootCAs = s.RootCAs
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ClientSpec declaratively describes a UAA OAuth client to be registered
+// (or reconciled) alongside the firehose client, e.g. a metrics-only
+// client scoped to just doppler.firehose, or a separate log-forwarding
+// client.
+type ClientSpec struct {
+	ClientID             string   `json:"client_id" yaml:"client_id"`
+	Secret               string   `json:"secret" yaml:"secret"`
+	Scopes               []string `json:"scopes" yaml:"scopes"`
+	AuthorizedGrantTypes []string `json:"authorized_grant_types" yaml:"authorized_grant_types"`
+	Authorities          []string `json:"authorities" yaml:"authorities"`
+	RedirectURIs         []string `json:"redirect_uris" yaml:"redirect_uris"`
+	AccessTokenValidity  int      `json:"access_token_validity" yaml:"access_token_validity"`
+	AutoApprove          bool     `json:"auto_approve" yaml:"auto_approve"`
+}
+
+// Manifest is the on-disk declaration of every UAA OAuth client a nozzle
+// deployment should provision on startup.
+type Manifest struct {
+	Clients []ClientSpec `json:"clients" yaml:"clients"`
+	// Prune, when true, causes every UAA client whose client_id is not
+	// listed in Clients to be deleted, not only clients that an earlier
+	// version of this manifest registered.
+	Prune bool `json:"prune" yaml:"prune"`
+}
+
+// LoadManifest reads a client manifest from a YAML or JSON file, chosen by
+// the file's extension (.yaml/.yml vs anything else).
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading client manifest %q: %w", path, err)
+	}
+
+	var manifest Manifest
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".yaml" || ext == ".yml" {
+		err = yaml.Unmarshal(data, &manifest)
+	} else {
+		err = json.Unmarshal(data, &manifest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing client manifest %q: %w", path, err)
+	}
+
+	return &manifest, nil
+}
@@ -0,0 +1,63 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/cf-platform-eng/splunk-firehose-nozzle/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadManifest", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "client-manifest")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("loads a YAML manifest", func() {
+		path := filepath.Join(dir, "clients.yaml")
+		yaml := `
+prune: true
+clients:
+  - client_id: metrics-client
+    secret: metrics-secret
+    scopes: [doppler.firehose]
+    authorized_grant_types: [client_credentials]
+`
+		Expect(ioutil.WriteFile(path, []byte(yaml), 0644)).To(Succeed())
+
+		manifest, err := LoadManifest(path)
+		Expect(err).To(BeNil())
+		Expect(manifest.Prune).To(BeTrue())
+		Expect(manifest.Clients).To(HaveLen(1))
+		Expect(manifest.Clients[0].ClientID).To(Equal("metrics-client"))
+		Expect(manifest.Clients[0].Scopes).To(Equal([]string{"doppler.firehose"}))
+	})
+
+	It("loads a JSON manifest", func() {
+		path := filepath.Join(dir, "clients.json")
+		json := `{
+			"prune": false,
+			"clients": [
+				{"client_id": "log-forwarding-client", "secret": "log-secret", "scopes": ["openid", "doppler.firehose"], "authorized_grant_types": ["client_credentials"]}
+			]
+		}`
+		Expect(ioutil.WriteFile(path, []byte(json), 0644)).To(Succeed())
+
+		manifest, err := LoadManifest(path)
+		Expect(err).To(BeNil())
+		Expect(manifest.Prune).To(BeFalse())
+		Expect(manifest.Clients).To(HaveLen(1))
+		Expect(manifest.Clients[0].ClientID).To(Equal("log-forwarding-client"))
+	})
+})
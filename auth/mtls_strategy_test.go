@@ -0,0 +1,115 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	. "github.com/cf-platform-eng/splunk-firehose-nozzle/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// generateSelfSignedCert returns a self-signed CA certificate usable both
+// as a server/client leaf certificate and as its own trust anchor, plus a
+// CertPool containing it.
+func generateSelfSignedCert(commonName string) (tls.Certificate, *x509.CertPool, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	parsed, err := x509.ParseCertificate(derBytes)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	return cert, pool, nil
+}
+
+var _ = Describe("MTLSStrategy", func() {
+	It("presents the configured client certificate over the wire", func() {
+		serverCert, _, err := generateSelfSignedCert("uaa.example.com")
+		Expect(err).To(BeNil())
+
+		clientCert, clientCAs, err := generateSelfSignedCert("nozzle-client")
+		Expect(err).To(BeNil())
+
+		var mu sync.Mutex
+		var presentedCommonNames []string
+
+		testServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			if len(r.TLS.PeerCertificates) > 0 {
+				presentedCommonNames = append(presentedCommonNames, r.TLS.PeerCertificates[0].Subject.CommonName)
+			}
+			mu.Unlock()
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		testServer.TLS = &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+		}
+		testServer.StartTLS()
+		defer testServer.Close()
+
+		strategy := NewMTLSStrategy(clientCert, nil, firehoseScopes)
+
+		// skipSSLValidation is true here because the test server's
+		// self-signed cert has no IP/DNS SAN for 127.0.0.1 - what's under
+		// test is that the client certificate is presented and accepted,
+		// not server certificate validation.
+		registrar, err := NewUaaRegistrar(testServer.URL, strategy, true, lager.NewLogger("test"))
+		Expect(err).To(BeNil())
+
+		// The fake server always returns 404, so RegisterFirehose won't
+		// succeed end-to-end - what matters here is that the TLS handshake
+		// completed at all, which it only will if the configured client
+		// certificate was presented and accepted.
+		registrar.RegisterFirehose("my-client", "my-secret")
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(presentedCommonNames).NotTo(BeEmpty())
+		Expect(presentedCommonNames[0]).To(Equal("nozzle-client"))
+	})
+})
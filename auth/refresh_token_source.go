@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RotatingRefreshTokenSource is a TokenRefresher that authenticates once
+// with client credentials and thereafter redeems the single-use refresh
+// token UAA issued for new access tokens. This avoids the bursts of full
+// client_credentials re-authentication traffic that large foundations
+// otherwise see every time a nozzle's access token expires.
+//
+// The refresh token UAA returns is wrapped in a RefreshEnvelope carrying a
+// stable id and a nonce that increments every time it's rotated, for local
+// bookkeeping of the chain. The envelope is persisted to Store so a nozzle
+// restart resumes the chain rather than re-authenticating.
+type RotatingRefreshTokenSource struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Store        TokenStore
+	HTTPClient   *http.Client
+}
+
+// NewRotatingRefreshTokenSource builds a RotatingRefreshTokenSource backed
+// by store. store may already contain an envelope from a previous process.
+func NewRotatingRefreshTokenSource(tokenURL, clientID, clientSecret string, store TokenStore) *RotatingRefreshTokenSource {
+	return &RotatingRefreshTokenSource{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Store:        store,
+	}
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshAuthToken exchanges the stored refresh token (or, on first use,
+// client credentials) for a new access token, then persists the new
+// refresh token UAA issued, wrapped in an envelope with the same id and an
+// incremented nonce.
+func (s *RotatingRefreshTokenSource) RefreshAuthToken() (string, error) {
+	envelope, err := s.Store.Load()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("client_id", s.ClientID)
+	form.Set("client_secret", s.ClientSecret)
+
+	if envelope == nil {
+		form.Set("grant_type", "client_credentials")
+		form.Set("token_format", "opaque")
+	} else {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", envelope.Token)
+	}
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.PostForm(s.TokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("requesting access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("uaa token endpoint returned %d", resp.StatusCode)
+	}
+
+	var parsed tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("decoding access token response: %w", err)
+	}
+	if parsed.RefreshToken == "" {
+		return "", fmt.Errorf("uaa did not return a refresh_token")
+	}
+
+	next := RefreshEnvelope{
+		Token:      parsed.RefreshToken,
+		LastUsedAt: time.Now(),
+	}
+	if envelope == nil {
+		next.ID = s.ClientID
+		next.Nonce = 0
+	} else {
+		next.ID = envelope.ID
+		next.Nonce = envelope.Nonce + 1
+	}
+
+	if err := s.Store.Save(&next); err != nil {
+		return "", fmt.Errorf("persisting refresh token envelope: %w", err)
+	}
+
+	return parsed.TokenType + " " + parsed.AccessToken, nil
+}
@@ -0,0 +1,154 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	. "github.com/cf-platform-eng/splunk-firehose-nozzle/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeUAATokenServer behaves like a real authorization server: it mints
+// its own opaque refresh tokens, tracks which one is currently valid for
+// each client, and rejects any refresh_token value it didn't itself issue
+// or that has already been rotated past.
+type fakeUAATokenServer struct {
+	mu             sync.Mutex
+	nextID         int
+	validByClient  map[string]string
+	redeemedTokens map[string]bool
+}
+
+func newFakeUAATokenServer() *fakeUAATokenServer {
+	return &fakeUAATokenServer{
+		validByClient:  map[string]string{},
+		redeemedTokens: map[string]bool{},
+	}
+}
+
+func (f *fakeUAATokenServer) mintRefreshToken() string {
+	f.nextID++
+	return fmt.Sprintf("uaa-issued-refresh-token-%d", f.nextID)
+}
+
+func (f *fakeUAATokenServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+	clientID := form.Get("client_id")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch form.Get("grant_type") {
+	case "client_credentials":
+		// ok
+
+	case "refresh_token":
+		presented := form.Get("refresh_token")
+		if f.redeemedTokens[presented] || f.validByClient[clientID] != presented {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		f.redeemedTokens[presented] = true
+
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	newRefreshToken := f.mintRefreshToken()
+	f.validByClient[clientID] = newRefreshToken
+
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token":  "fresh-access-token",
+		"token_type":    "Bearer",
+		"refresh_token": newRefreshToken,
+	})
+}
+
+var _ = Describe("RotatingRefreshTokenSource", func() {
+	var (
+		fakeUAA *fakeUAATokenServer
+		server  *httptest.Server
+		store   *InMemoryTokenStore
+		source  *RotatingRefreshTokenSource
+	)
+
+	BeforeEach(func() {
+		fakeUAA = newFakeUAATokenServer()
+		server = httptest.NewServer(http.HandlerFunc(fakeUAA.handle))
+
+		store = NewInMemoryTokenStore()
+		source = NewRotatingRefreshTokenSource(server.URL, "my-client", "my-secret", store)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("authenticates with client credentials on first use and stores the refresh token UAA issues", func() {
+		token, err := source.RefreshAuthToken()
+		Expect(err).To(BeNil())
+		Expect(token).To(Equal("Bearer fresh-access-token"))
+
+		envelope, err := store.Load()
+		Expect(err).To(BeNil())
+		Expect(envelope.ID).To(Equal("my-client"))
+		Expect(envelope.Nonce).To(Equal(0))
+		Expect(envelope.Token).To(Equal(fakeUAA.validByClient["my-client"]))
+	})
+
+	It("redeems the real refresh token on every subsequent refresh and increments its nonce", func() {
+		_, err := source.RefreshAuthToken()
+		Expect(err).To(BeNil())
+
+		var lastToken string
+		for i := 0; i < 3; i++ {
+			envelopeBefore, err := store.Load()
+			Expect(err).To(BeNil())
+			lastToken = envelopeBefore.Token
+
+			_, err = source.RefreshAuthToken()
+			Expect(err).To(BeNil())
+
+			envelopeAfter, err := store.Load()
+			Expect(err).To(BeNil())
+			Expect(envelopeAfter.Nonce).To(Equal(i + 1))
+			Expect(envelopeAfter.Token).NotTo(Equal(lastToken))
+		}
+	})
+
+	It("fails when replaying an already-rotated refresh token", func() {
+		_, err := source.RefreshAuthToken()
+		Expect(err).To(BeNil())
+
+		staleEnvelope, err := store.Load()
+		Expect(err).To(BeNil())
+
+		_, err = source.RefreshAuthToken()
+		Expect(err).To(BeNil())
+
+		// Rewind the store to the now-rotated-past envelope, simulating a
+		// stale copy being replayed (e.g. from a restored backup).
+		Expect(store.Save(staleEnvelope)).To(Succeed())
+
+		_, err = source.RefreshAuthToken()
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("rejects a refresh token it never issued", func() {
+		Expect(store.Save(&RefreshEnvelope{ID: "my-client", Nonce: 0, Token: "forged-token"})).To(Succeed())
+
+		_, err := source.RefreshAuthToken()
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ApplyManifest registers every client in manifest.Clients, then, if
+// manifest.Prune is set, deletes any UAA client not described by the
+// manifest. This is the single idempotent pass a nozzle runs at startup to
+// reconcile UAA with a loaded client manifest.
+func ApplyManifest(ctx context.Context, registrar UaaRegistrar, manifest *Manifest) error {
+	if err := registrar.RegisterClients(ctx, manifest.Clients); err != nil {
+		return err
+	}
+
+	if !manifest.Prune {
+		return nil
+	}
+
+	return registrar.PruneClients(ctx, manifest.Clients)
+}
+
+func clientFromSpec(spec ClientSpec) *Client {
+	return &Client{
+		ClientID:             spec.ClientID,
+		ClientSecret:         spec.Secret,
+		Scope:                spec.Scopes,
+		AuthorizedGrantTypes: spec.AuthorizedGrantTypes,
+		Authorities:          spec.Authorities,
+		RedirectURI:          spec.RedirectURIs,
+		AccessTokenValidity:  spec.AccessTokenValidity,
+		Autoapprove:          spec.AutoApprove,
+	}
+}
+
+// RegisterClients idempotently creates or updates every client described by
+// specs, in order, stopping at the first error. A single nozzle deployment
+// uses this to provision all of its downstream OAuth identities - e.g. a
+// metrics-only client alongside a separate log-forwarding client - in one
+// pass.
+func (u *uaaRegistrar) RegisterClients(ctx context.Context, specs []ClientSpec) error {
+	for _, spec := range specs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		client := clientFromSpec(spec)
+
+		exists, err := u.clientExists(ctx, client.ClientID)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			if err := u.createClient(ctx, client); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := u.updateClient(ctx, client); err != nil {
+			return err
+		}
+
+		if client.ClientSecret != "" {
+			if err := u.updateClientSecret(ctx, client.ClientID, client.ClientSecret); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// PruneClients deletes every UAA client whose client_id is not present in
+// keep. It's used to reconcile UAA against a manifest whose Prune flag is
+// set, so clients removed from the manifest are removed from UAA too.
+func (u *uaaRegistrar) PruneClients(ctx context.Context, keep []ClientSpec) error {
+	keepIDs := make(map[string]bool, len(keep))
+	for _, spec := range keep {
+		keepIDs[spec.ClientID] = true
+	}
+
+	resp, body, err := u.do(ctx, "GET", "/oauth/clients", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to list clients: %d %s", resp.StatusCode, body)
+	}
+
+	var list struct {
+		Resources []struct {
+			ClientID string `json:"client_id"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return fmt.Errorf("parsing client list: %w", err)
+	}
+
+	for _, resource := range list.Resources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if keepIDs[resource.ClientID] {
+			continue
+		}
+
+		resp, body, err := u.do(ctx, "DELETE", "/oauth/clients/"+resource.ClientID, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unable to delete client %q: %d %s", resource.ClientID, resp.StatusCode, body)
+		}
+	}
+
+	return nil
+}
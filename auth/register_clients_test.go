@@ -0,0 +1,251 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/lager"
+
+	. "github.com/cf-platform-eng/splunk-firehose-nozzle/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RegisterClients", func() {
+	type testServerResponse struct {
+		body []byte
+		code int
+	}
+
+	type testServerRequest struct {
+		request *http.Request
+		body    []byte
+	}
+
+	var (
+		testServer       *httptest.Server
+		capturedRequests []*testServerRequest
+		responses        []testServerResponse
+		logger           lager.Logger
+		registrar        UaaRegistrar
+	)
+
+	BeforeEach(func() {
+		capturedRequests = []*testServerRequest{}
+		responses = []testServerResponse{}
+
+		testServer = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			body, _ := ioutil.ReadAll(request.Body)
+			capturedRequests = append(capturedRequests, &testServerRequest{request: request, body: body})
+
+			response := responses[0]
+			responses = responses[1:]
+
+			if response.body != nil {
+				writer.Write(response.body)
+			}
+			if response.code != 200 {
+				writer.WriteHeader(response.code)
+			}
+		}))
+
+		logger = lager.NewLogger("test")
+		registrar, _ = NewUaaRegistrar(
+			testServer.URL, NewClientCredentialsStrategy(&MockTokenRefresher{}, firehoseScopes), true, logger,
+		)
+	})
+
+	AfterEach(func() {
+		testServer.Close()
+	})
+
+	It("creates clients that don't exist and updates ones that do", func() {
+		specs := []ClientSpec{
+			{
+				ClientID:             "metrics-client",
+				Secret:               "metrics-secret",
+				Scopes:               []string{"doppler.firehose"},
+				AuthorizedGrantTypes: []string{"client_credentials"},
+			},
+			{
+				ClientID:             "log-forwarding-client",
+				Secret:               "log-secret",
+				Scopes:               []string{"openid", "doppler.firehose"},
+				AuthorizedGrantTypes: []string{"client_credentials"},
+			},
+		}
+
+		responses = append(responses,
+			testServerResponse{code: 404}, // GET metrics-client
+			testServerResponse{code: 201}, // POST metrics-client
+			testServerResponse{code: 200}, // GET log-forwarding-client
+			testServerResponse{code: 200}, // PUT log-forwarding-client
+			testServerResponse{code: 200}, // PUT log-forwarding-client secret
+		)
+
+		err := registrar.RegisterClients(context.Background(), specs)
+		Expect(err).To(BeNil())
+		Expect(capturedRequests).To(HaveLen(5))
+
+		var metricsPayload map[string]interface{}
+		Expect(json.Unmarshal(capturedRequests[1].body, &metricsPayload)).To(Succeed())
+		Expect(metricsPayload["client_id"]).To(Equal("metrics-client"))
+		Expect(metricsPayload["scope"]).To(Equal([]interface{}{"doppler.firehose"}))
+
+		Expect(capturedRequests[3].request.Method).To(Equal("PUT"))
+		Expect(capturedRequests[3].request.URL.Path).To(Equal("/oauth/clients/log-forwarding-client"))
+
+		Expect(capturedRequests[4].request.Method).To(Equal("PUT"))
+		Expect(capturedRequests[4].request.URL.Path).To(Equal("/oauth/clients/log-forwarding-client/secret"))
+	})
+
+	Context("pruning", func() {
+		It("deletes clients present on UAA but absent from the manifest", func() {
+			keep := []ClientSpec{{ClientID: "metrics-client"}}
+
+			listBody, err := json.Marshal(map[string]interface{}{
+				"resources": []map[string]string{
+					{"client_id": "metrics-client"},
+					{"client_id": "stale-client"},
+				},
+			})
+			Expect(err).To(BeNil())
+
+			responses = append(responses,
+				testServerResponse{code: 200, body: listBody}, // GET /oauth/clients
+				testServerResponse{code: 200},                 // DELETE stale-client
+			)
+
+			err = registrar.PruneClients(context.Background(), keep)
+			Expect(err).To(BeNil())
+			Expect(capturedRequests).To(HaveLen(2))
+
+			Expect(capturedRequests[1].request.Method).To(Equal("DELETE"))
+			Expect(capturedRequests[1].request.URL.Path).To(Equal("/oauth/clients/stale-client"))
+		})
+	})
+})
+
+var _ = Describe("ApplyManifest", func() {
+	type testServerResponse struct {
+		body []byte
+		code int
+	}
+
+	type testServerRequest struct {
+		request *http.Request
+	}
+
+	var (
+		testServer       *httptest.Server
+		capturedRequests []*testServerRequest
+		responses        []testServerResponse
+		logger           lager.Logger
+		registrar        UaaRegistrar
+		dir              string
+	)
+
+	BeforeEach(func() {
+		capturedRequests = []*testServerRequest{}
+		responses = []testServerResponse{}
+
+		testServer = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ioutil.ReadAll(request.Body)
+			capturedRequests = append(capturedRequests, &testServerRequest{request: request})
+
+			response := responses[0]
+			responses = responses[1:]
+
+			if response.body != nil {
+				writer.Write(response.body)
+			}
+			if response.code != 200 {
+				writer.WriteHeader(response.code)
+			}
+		}))
+
+		logger = lager.NewLogger("test")
+		registrar, _ = NewUaaRegistrar(
+			testServer.URL, NewClientCredentialsStrategy(&MockTokenRefresher{}, firehoseScopes), true, logger,
+		)
+
+		var err error
+		dir, err = ioutil.TempDir("", "apply-manifest")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		testServer.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("registers every manifest client and prunes clients UAA has that the manifest doesn't, when Prune is set", func() {
+		path := filepath.Join(dir, "clients.yaml")
+		manifestYAML := `
+prune: true
+clients:
+  - client_id: metrics-client
+    secret: metrics-secret
+    scopes: [doppler.firehose]
+    authorized_grant_types: [client_credentials]
+`
+		Expect(ioutil.WriteFile(path, []byte(manifestYAML), 0644)).To(Succeed())
+
+		manifest, err := LoadManifest(path)
+		Expect(err).To(BeNil())
+
+		listBody, err := json.Marshal(map[string]interface{}{
+			"resources": []map[string]string{
+				{"client_id": "metrics-client"},
+				{"client_id": "stale-client"},
+			},
+		})
+		Expect(err).To(BeNil())
+
+		responses = append(responses,
+			testServerResponse{code: 404},                 // GET metrics-client
+			testServerResponse{code: 201},                 // POST metrics-client
+			testServerResponse{code: 200, body: listBody}, // GET /oauth/clients (prune listing)
+			testServerResponse{code: 200},                 // DELETE stale-client
+		)
+
+		err = ApplyManifest(context.Background(), registrar, manifest)
+		Expect(err).To(BeNil())
+		Expect(capturedRequests).To(HaveLen(4))
+
+		Expect(capturedRequests[1].request.Method).To(Equal("POST"))
+		Expect(capturedRequests[1].request.URL.Path).To(Equal("/oauth/clients"))
+
+		Expect(capturedRequests[3].request.Method).To(Equal("DELETE"))
+		Expect(capturedRequests[3].request.URL.Path).To(Equal("/oauth/clients/stale-client"))
+	})
+
+	It("does not prune when the manifest's Prune flag is unset", func() {
+		path := filepath.Join(dir, "clients.json")
+		manifestJSON := `{
+			"prune": false,
+			"clients": [
+				{"client_id": "metrics-client", "secret": "metrics-secret", "scopes": ["doppler.firehose"], "authorized_grant_types": ["client_credentials"]}
+			]
+		}`
+		Expect(ioutil.WriteFile(path, []byte(manifestJSON), 0644)).To(Succeed())
+
+		manifest, err := LoadManifest(path)
+		Expect(err).To(BeNil())
+
+		responses = append(responses,
+			testServerResponse{code: 404}, // GET metrics-client
+			testServerResponse{code: 201}, // POST metrics-client
+		)
+
+		err = ApplyManifest(context.Background(), registrar, manifest)
+		Expect(err).To(BeNil())
+		Expect(capturedRequests).To(HaveLen(2))
+	})
+})
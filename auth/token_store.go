@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// RefreshEnvelope wraps the opaque refresh token UAA issued, along with a
+// monotonically increasing nonce that records how many times the chain has
+// been rotated. Nothing in this package compares nonces: a replayed
+// (already-rotated) refresh token is caught only when UAA rejects it. Token
+// is always the literal value handed out by UAA; it's what gets redeemed on
+// the next refresh, never the envelope itself.
+type RefreshEnvelope struct {
+	ID         string    `json:"id"`
+	Nonce      int       `json:"nonce"`
+	Token      string    `json:"token"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// TokenStore persists the current refresh token envelope so a nozzle
+// restart can resume a refresh-token chain instead of re-authenticating
+// with client credentials.
+type TokenStore interface {
+	Load() (*RefreshEnvelope, error)
+	Save(envelope *RefreshEnvelope) error
+}
+
+// InMemoryTokenStore keeps the envelope in process memory only; it does
+// not survive a restart.
+type InMemoryTokenStore struct {
+	mu       sync.Mutex
+	envelope *RefreshEnvelope
+}
+
+func NewInMemoryTokenStore() *InMemoryTokenStore {
+	return &InMemoryTokenStore{}
+}
+
+func (s *InMemoryTokenStore) Load() (*RefreshEnvelope, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.envelope, nil
+}
+
+func (s *InMemoryTokenStore) Save(envelope *RefreshEnvelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.envelope = envelope
+	return nil
+}
+
+// FileTokenStore persists the envelope as JSON at Path, so it survives a
+// nozzle restart.
+type FileTokenStore struct {
+	Path string
+}
+
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+func (s *FileTokenStore) Load() (*RefreshEnvelope, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope RefreshEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+func (s *FileTokenStore) Save(envelope *RefreshEnvelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, data, 0600)
+}
@@ -0,0 +1,48 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/cf-platform-eng/splunk-firehose-nozzle/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FileTokenStore", func() {
+	var path string
+
+	BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "token-store")
+		Expect(err).To(BeNil())
+		path = filepath.Join(dir, "refresh-token.json")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Dir(path))
+	})
+
+	It("returns a nil envelope when no file exists yet", func() {
+		store := NewFileTokenStore(path)
+
+		envelope, err := store.Load()
+		Expect(err).To(BeNil())
+		Expect(envelope).To(BeNil())
+	})
+
+	It("round-trips a saved envelope", func() {
+		store := NewFileTokenStore(path)
+
+		saved := &RefreshEnvelope{ID: "my-client", Nonce: 2, LastUsedAt: time.Now().Round(time.Second)}
+		Expect(store.Save(saved)).To(Succeed())
+
+		loaded, err := store.Load()
+		Expect(err).To(BeNil())
+		Expect(loaded.ID).To(Equal(saved.ID))
+		Expect(loaded.Nonce).To(Equal(saved.Nonce))
+		Expect(loaded.LastUsedAt.Equal(saved.LastUsedAt)).To(BeTrue())
+	})
+})
@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBaseDelay  = 500 * time.Millisecond
+)
+
+// TokenRefresher knows how to obtain a fresh bearer token from UAA.
+type TokenRefresher interface {
+	RefreshAuthToken() (string, error)
+}
+
+// UaaRegistrar registers (or updates) OAuth clients with UAA so the
+// firehose nozzle can authenticate against the doppler firehose.
+type UaaRegistrar interface {
+	RegisterFirehose(clientID, clientSecret string) error
+
+	// RegisterClients idempotently creates or updates every client
+	// described by specs, following the same GET -> POST-or-PUT ->
+	// secret-rotation dance as RegisterFirehose.
+	RegisterClients(ctx context.Context, specs []ClientSpec) error
+
+	// PruneClients deletes every UAA client whose client_id is not
+	// present in keep. Used to reconcile UAA against a manifest whose
+	// Prune flag is set.
+	PruneClients(ctx context.Context, keep []ClientSpec) error
+}
+
+// AuthChallenge is the parsed form of a WWW-Authenticate response header,
+// e.g. `Bearer error="invalid_token", error_description="token expired"`.
+type AuthChallenge struct {
+	Scheme string
+	Params map[string]string
+}
+
+// Expired reports whether the challenge indicates the presented token has
+// expired or is otherwise no longer valid, as opposed to being valid but
+// lacking sufficient scope.
+func (c AuthChallenge) Expired() bool {
+	return c.Params["error"] == "invalid_token"
+}
+
+func parseWWWAuthenticate(header string) AuthChallenge {
+	challenge := AuthChallenge{Params: map[string]string{}}
+	if header == "" {
+		return challenge
+	}
+
+	parts := strings.SplitN(header, " ", 2)
+	challenge.Scheme = parts[0]
+	if len(parts) == 1 {
+		return challenge
+	}
+
+	for _, pair := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		challenge.Params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+
+	return challenge
+}
+
+// RegistrarError is returned when a request to UAA ultimately fails, after
+// any auth-refresh retries have been exhausted. It carries the parsed
+// WWW-Authenticate challenge (if any) so callers can log why UAA rejected
+// the request.
+type RegistrarError struct {
+	StatusCode int
+	Challenge  AuthChallenge
+	Err        error
+}
+
+func (e *RegistrarError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RegistrarError) Unwrap() error {
+	return e.Err
+}
+
+type registrarOptions struct {
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+// RegistrarOption configures optional behavior of UaaRegistrar.
+type RegistrarOption func(*registrarOptions)
+
+// WithMaxRetries caps the number of token-refresh-and-retry attempts made
+// when UAA responds with an expired-token challenge.
+func WithMaxRetries(n int) RegistrarOption {
+	return func(o *registrarOptions) {
+		o.maxRetries = n
+	}
+}
+
+// WithBackoffBaseDelay sets the base delay used for exponential backoff
+// between retries. Attempt N waits baseDelay * 2^(N-1).
+func WithBackoffBaseDelay(d time.Duration) RegistrarOption {
+	return func(o *registrarOptions) {
+		o.baseDelay = d
+	}
+}
+
+type uaaRegistrar struct {
+	apiUrl   string
+	strategy AuthStrategy
+	client   *http.Client
+	logger   lager.Logger
+
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+// NewUaaRegistrar creates a UaaRegistrar that authenticates to UAA using
+// the given AuthStrategy, performing the initial authentication eagerly so
+// construction fails fast if credentials are bad.
+func NewUaaRegistrar(apiUrl string, strategy AuthStrategy, skipSSLValidation bool, logger lager.Logger, opts ...RegistrarOption) (UaaRegistrar, error) {
+	if err := strategy.Refresh(); err != nil {
+		return nil, err
+	}
+
+	options := registrarOptions{
+		maxRetries: defaultMaxRetries,
+		baseDelay:  defaultBaseDelay,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: skipSSLValidation},
+	}
+	strategy.ConfigureTransport(transport)
+
+	return &uaaRegistrar{
+		apiUrl:     apiUrl,
+		strategy:   strategy,
+		client:     &http.Client{Transport: transport},
+		logger:     logger,
+		maxRetries: options.maxRetries,
+		baseDelay:  options.baseDelay,
+	}, nil
+}
+
+// Client is the UAA oauth/clients payload used to create or update an
+// OAuth client registration.
+type Client struct {
+	ClientID             string   `json:"client_id"`
+	ClientSecret         string   `json:"client_secret,omitempty"`
+	Scope                []string `json:"scope"`
+	AuthorizedGrantTypes []string `json:"authorized_grant_types"`
+	Authorities          []string `json:"authorities,omitempty"`
+	RedirectURI          []string `json:"redirect_uri,omitempty"`
+	AccessTokenValidity  int      `json:"access_token_validity,omitempty"`
+	Autoapprove          bool     `json:"autoapprove,omitempty"`
+}
+
+func (u *uaaRegistrar) RegisterFirehose(clientID, clientSecret string) error {
+	ctx := context.Background()
+
+	exists, err := u.clientExists(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	client := &Client{
+		ClientID:             clientID,
+		ClientSecret:         clientSecret,
+		Scope:                u.strategy.Scopes(),
+		AuthorizedGrantTypes: []string{u.strategy.GrantType()},
+	}
+
+	if !exists {
+		return u.createClient(ctx, client)
+	}
+
+	if err := u.updateClient(ctx, client); err != nil {
+		return err
+	}
+
+	return u.updateClientSecret(ctx, clientID, clientSecret)
+}
+
+func (u *uaaRegistrar) clientExists(ctx context.Context, clientID string) (bool, error) {
+	resp, _, err := u.do(ctx, "GET", "/oauth/clients/"+clientID, nil)
+	if err != nil {
+		return false, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unable to determine if client %q exists: unexpected status %d", clientID, resp.StatusCode)
+	}
+}
+
+func (u *uaaRegistrar) createClient(ctx context.Context, client *Client) error {
+	body, err := json.Marshal(client)
+	if err != nil {
+		return err
+	}
+
+	resp, respBody, err := u.do(ctx, "POST", "/oauth/clients", body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unable to create client %q: %d %s", client.ClientID, resp.StatusCode, respBody)
+	}
+
+	return nil
+}
+
+func (u *uaaRegistrar) updateClient(ctx context.Context, client *Client) error {
+	update := *client
+	update.ClientSecret = ""
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	resp, respBody, err := u.do(ctx, "PUT", "/oauth/clients/"+client.ClientID, body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to update client %q: %d %s", client.ClientID, resp.StatusCode, respBody)
+	}
+
+	return nil
+}
+
+func (u *uaaRegistrar) updateClientSecret(ctx context.Context, clientID, secret string) error {
+	body, err := json.Marshal(map[string]string{"secret": secret})
+	if err != nil {
+		return err
+	}
+
+	resp, respBody, err := u.do(ctx, "PUT", "/oauth/clients/"+clientID+"/secret", body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to update secret for client %q: %d %s", clientID, resp.StatusCode, respBody)
+	}
+
+	return nil
+}
+
+// do issues a request against the UAA API, transparently refreshing the
+// bearer token and retrying with exponential backoff when UAA responds
+// with a 401/403 challenge indicating the token has expired. Only one
+// user-visible error is returned once retries are exhausted. ctx bounds
+// both the in-flight request and the backoff sleep between retries, so a
+// cancelled context interrupts the client currently being processed
+// instead of only taking effect at the next call to do.
+func (u *uaaRegistrar) do(ctx context.Context, method, path string, body []byte) (*http.Response, []byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= u.maxRetries; attempt++ {
+		var reqBody *bytes.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+
+		var req *http.Request
+		var err error
+		if reqBody != nil {
+			req, err = http.NewRequest(method, u.apiUrl+path, reqBody)
+		} else {
+			req, err = http.NewRequest(method, u.apiUrl+path, nil)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		req = req.WithContext(ctx)
+
+		authHeader, err := u.strategy.AuthHeader()
+		if err != nil {
+			return nil, nil, err
+		}
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		if body != nil {
+			req.Header.Set("Content-type", "application/json")
+		}
+
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+			return resp, respBody, nil
+		}
+
+		challenge := parseWWWAuthenticate(resp.Header.Get("WWW-Authenticate"))
+		if !challenge.Expired() {
+			return nil, nil, &RegistrarError{
+				StatusCode: resp.StatusCode,
+				Challenge:  challenge,
+				Err:        fmt.Errorf("uaa rejected request to %s %s: %d %s", method, path, resp.StatusCode, respBody),
+			}
+		}
+
+		lastErr = &RegistrarError{
+			StatusCode: resp.StatusCode,
+			Challenge:  challenge,
+			Err:        fmt.Errorf("uaa token expired on %s %s: %d %s", method, path, resp.StatusCode, respBody),
+		}
+
+		if attempt == u.maxRetries {
+			break
+		}
+
+		u.logger.Info("uaa-token-expired-retrying", lager.Data{"attempt": attempt + 1, "path": path})
+
+		if err := u.strategy.Refresh(); err != nil {
+			return nil, nil, err
+		}
+
+		select {
+		case <-time.After(u.baseDelay * time.Duration(1<<uint(attempt))):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	return nil, nil, lastErr
+}
@@ -3,22 +3,28 @@ package auth_test
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 
 	. "github.com/cf-platform-eng/splunk-firehose-nozzle/auth"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
 
+var firehoseScopes = []string{"openid", "oauth.approvals", "doppler.firehose"}
+
 var _ = Describe("uaa_registrar", func() {
 	type testServerResponse struct {
-		body []byte
-		code int
+		body   []byte
+		code   int
+		header http.Header
 	}
 
 	type testServerRequest struct {
@@ -52,6 +58,11 @@ var _ = Describe("uaa_registrar", func() {
 			response := responses[0]
 			responses = responses[1:]
 
+			for key, values := range response.header {
+				for _, value := range values {
+					writer.Header().Add(key, value)
+				}
+			}
 			if response.body != nil {
 				writer.Write(response.body)
 			}
@@ -77,7 +88,7 @@ var _ = Describe("uaa_registrar", func() {
 		}
 
 		_, err := NewUaaRegistrar(
-			"https://uaa.example.com", tokenRefresher, true, logger,
+			"https://uaa.example.com", NewClientCredentialsStrategy(tokenRefresher, firehoseScopes), true, logger,
 		)
 
 		Expect(err).To(BeNil())
@@ -90,7 +101,7 @@ var _ = Describe("uaa_registrar", func() {
 		}
 
 		registrar, err := NewUaaRegistrar(
-			testServer.URL, tokenRefresher, true, logger,
+			testServer.URL, NewClientCredentialsStrategy(tokenRefresher, firehoseScopes), true, logger,
 		)
 
 		Expect(registrar).To(BeNil())
@@ -102,7 +113,7 @@ var _ = Describe("uaa_registrar", func() {
 
 		BeforeEach(func() {
 			registrar, _ = NewUaaRegistrar(
-				testServer.URL, tokenRefresher, true, logger,
+				testServer.URL, NewClientCredentialsStrategy(tokenRefresher, firehoseScopes), true, logger,
 			)
 		})
 
@@ -158,6 +169,77 @@ var _ = Describe("uaa_registrar", func() {
 			})
 		})
 
+		Context("token expires mid-flow", func() {
+			It("refreshes the token and retries on 401", func() {
+				refreshCount := 0
+				tokenRefresher.RefreshAuthTokenFn = func() (string, error) {
+					refreshCount++
+					return fmt.Sprintf("token-%d", refreshCount), nil
+				}
+				// Construction itself performs one refresh (refreshCount == 1,
+				// token-1), which is what the first request below is signed with.
+				registrar, _ = NewUaaRegistrar(testServer.URL, NewClientCredentialsStrategy(tokenRefresher, firehoseScopes), true, logger)
+				Expect(refreshCount).To(Equal(1))
+
+				responses = append(responses,
+					testServerResponse{code: 401, header: http.Header{"WWW-Authenticate": {`Bearer error="invalid_token"`}}},
+					testServerResponse{code: 404},
+					testServerResponse{code: 201},
+				)
+
+				err := registrar.RegisterFirehose("my-firehose-user", "my-firehose-secret")
+				Expect(err).To(BeNil())
+				Expect(refreshCount).To(Equal(2))
+
+				Expect(capturedRequests[0].request.Header.Get("Authorization")).To(Equal("token-1"))
+				Expect(capturedRequests[1].request.Header.Get("Authorization")).To(Equal("token-2"))
+			})
+
+			It("returns a single error once retries are exhausted", func() {
+				tokenRefresher.RefreshAuthTokenFn = func() (string, error) {
+					return "my-token", nil
+				}
+				registrar, _ = NewUaaRegistrar(
+					testServer.URL, NewClientCredentialsStrategy(tokenRefresher, firehoseScopes), true, logger, WithMaxRetries(2), WithBackoffBaseDelay(time.Millisecond),
+				)
+
+				for i := 0; i < 3; i++ {
+					responses = append(responses, testServerResponse{
+						code:   401,
+						header: http.Header{"WWW-Authenticate": {`Bearer error="invalid_token"`}},
+					})
+				}
+
+				err := registrar.RegisterFirehose("my-firehose-user", "my-firehose-secret")
+				Expect(err).NotTo(BeNil())
+				Expect(capturedRequests).To(HaveLen(3))
+
+				registrarErr, ok := err.(*RegistrarError)
+				Expect(ok).To(BeTrue())
+				Expect(registrarErr.Challenge.Expired()).To(BeTrue())
+			})
+
+			It("does not retry on insufficient_scope challenges", func() {
+				tokenRefresher.RefreshAuthTokenFn = func() (string, error) {
+					return "my-token", nil
+				}
+				registrar, _ = NewUaaRegistrar(testServer.URL, NewClientCredentialsStrategy(tokenRefresher, firehoseScopes), true, logger)
+
+				responses = append(responses, testServerResponse{
+					code:   403,
+					header: http.Header{"WWW-Authenticate": {`Bearer error="insufficient_scope"`}},
+				})
+
+				err := registrar.RegisterFirehose("my-firehose-user", "my-firehose-secret")
+				Expect(err).NotTo(BeNil())
+				Expect(capturedRequests).To(HaveLen(1))
+
+				registrarErr, ok := err.(*RegistrarError)
+				Expect(ok).To(BeTrue())
+				Expect(registrarErr.Challenge.Expired()).To(BeFalse())
+			})
+		})
+
 		Context("client present", func() {
 			It("correctly calls update client", func() {
 				responses = append(responses, testServerResponse{code: 200}, testServerResponse{code: 200}, testServerResponse{code: 200})
@@ -220,6 +302,105 @@ var _ = Describe("uaa_registrar", func() {
 	})
 })
 
+var _ = Describe("AuthStrategy", func() {
+	var (
+		testServer       *httptest.Server
+		capturedRequests []*http.Request
+		capturedBodies   [][]byte
+		responses        []int
+		logger           lager.Logger
+	)
+
+	BeforeEach(func() {
+		capturedRequests = nil
+		capturedBodies = nil
+		responses = nil
+
+		testServer = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			body, _ := ioutil.ReadAll(request.Body)
+			capturedRequests = append(capturedRequests, request)
+			capturedBodies = append(capturedBodies, body)
+
+			code := responses[0]
+			responses = responses[1:]
+			writer.WriteHeader(code)
+		}))
+
+		logger = lager.NewLogger("test")
+	})
+
+	AfterEach(func() {
+		testServer.Close()
+	})
+
+	DescribeTable("registers a client using the strategy's grant type and scope",
+		func(buildStrategy func() AuthStrategy, expectedGrantType string, expectedScope []string) {
+			responses = append(responses, 404, 201)
+
+			registrar, err := NewUaaRegistrar(testServer.URL, buildStrategy(), true, logger)
+			Expect(err).To(BeNil())
+
+			err = registrar.RegisterFirehose("my-client", "my-secret")
+			Expect(err).To(BeNil())
+
+			var payload map[string]interface{}
+			Expect(json.Unmarshal(capturedBodies[1], &payload)).To(Succeed())
+
+			expectedScopeIface := make([]interface{}, len(expectedScope))
+			for i, s := range expectedScope {
+				expectedScopeIface[i] = s
+			}
+
+			Expect(payload["authorized_grant_types"]).To(Equal([]interface{}{expectedGrantType}))
+			Expect(payload["scope"]).To(Equal(expectedScopeIface))
+		},
+
+		Entry("client_credentials", func() AuthStrategy {
+			return NewClientCredentialsStrategy(&MockTokenRefresher{}, firehoseScopes)
+		}, "client_credentials", firehoseScopes),
+
+		Entry("jwt-bearer", func() AuthStrategy {
+			jwtServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-type", "application/json")
+				w.Write([]byte(`{"access_token": "jwt-access-token", "token_type": "Bearer"}`))
+			}))
+			return NewJWTBearerStrategy(jwtServer.URL, "my-jwt-client", func(clientID string) (string, error) {
+				return "signed-assertion-for-" + clientID, nil
+			}, firehoseScopes)
+		}, "urn:ietf:params:oauth:grant-type:jwt-bearer", firehoseScopes),
+	)
+
+	It("authenticates client_credentials and jwt-bearer requests with an Authorization header", func() {
+		responses = append(responses, 404, 201, 404, 201)
+
+		strategy := NewClientCredentialsStrategy(&MockTokenRefresher{RefreshAuthTokenFn: func() (string, error) {
+			return "Bearer my-token", nil
+		}}, firehoseScopes)
+
+		registrar, err := NewUaaRegistrar(testServer.URL, strategy, true, logger)
+		Expect(err).To(BeNil())
+		Expect(registrar.RegisterFirehose("my-client", "my-secret")).To(Succeed())
+
+		Expect(capturedRequests[0].Header.Get("Authorization")).To(Equal("Bearer my-token"))
+
+		jwtServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-type", "application/json")
+			w.Write([]byte(`{"access_token": "jwt-access-token", "token_type": "Bearer"}`))
+		}))
+		defer jwtServer.Close()
+
+		jwtStrategy := NewJWTBearerStrategy(jwtServer.URL, "my-jwt-client", func(clientID string) (string, error) {
+			return "signed-assertion-for-" + clientID, nil
+		}, firehoseScopes)
+
+		registrar, err = NewUaaRegistrar(testServer.URL, jwtStrategy, true, logger)
+		Expect(err).To(BeNil())
+		Expect(registrar.RegisterFirehose("my-client", "my-secret")).To(Succeed())
+
+		Expect(capturedRequests[2].Header.Get("Authorization")).To(Equal("Bearer jwt-access-token"))
+	})
+})
+
 type MockTokenRefresher struct {
 	RefreshAuthTokenFn func() (string, error)
 }